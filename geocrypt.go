@@ -7,13 +7,19 @@ package geocrypt
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
 	"sort"
+	"strconv"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
 )
 
 const (
@@ -25,6 +31,13 @@ const (
 	// that may be passed to Hash and Error.
 	MaxPrecision = 9
 
+	// MaxPrecisionArgon2 is the maximum allowable precision that may
+	// be passed to HashWith when used with Argon2idKDF or ScryptKDF.
+	// Unlike BcryptKDF, these do not map precision onto bcrypt's cost
+	// range, so precision is instead bounded only by the 64 bit width
+	// of the underlying geohash.
+	MaxPrecisionArgon2 = 10
+
 	// DefaultPrecision corresponds to approximately one
 	// diagonal metre at the equator.
 	DefaultPrecision = 7
@@ -39,6 +52,9 @@ var ErrInvalidPrecision = errors.New("geocrypt: location precision out of range"
 // The error returned from Hash or Compare when note text is longer than 64 bytes.
 var ErrTextTooLong = errors.New("geocrypt: note text is too long")
 
+// The error returned from HashRadius and radiusCovering when radiusMeters is not positive.
+var ErrInvalidRadius = errors.New("geocrypt: radius must be positive")
+
 // Hash returns the geocrypt hash set of the location at the given
 // latitude and longitude and note text with the given precisions.
 // The note text is appended to the geohash of the location before
@@ -49,31 +65,352 @@ func Hash(lat, long float64, text string, precs ...int) ([]byte, error) {
 	if len(text) > 64 {
 		return nil, ErrTextTooLong
 	}
+	return HashWith(BcryptKDF{}, lat, long, text, precs...)
+}
+
+// normalizePrecisions validates precs and returns it sorted in
+// descending order with duplicates removed. If precs is empty,
+// DefaultPrecision is returned.
+func normalizePrecisions(precs []int) ([]int, error) {
+	return normalizePrecisionsFor(MaxPrecision, precs)
+}
+
+// normalizePrecisionsFor is normalizePrecisions with the maximum
+// precision given explicitly, since HashWith's ceiling depends on the
+// KDF in use; see maxPrecisionFor.
+func normalizePrecisionsFor(maxPrec int, precs []int) ([]int, error) {
 	for i, p := range precs {
-		if p < MinPrecision || MaxPrecision < p {
+		if p < MinPrecision || maxPrec < p {
 			return nil, fmt.Errorf("%w: position %d: %d", ErrInvalidPrecision, i, p)
 		}
 	}
 	switch len(precs) {
 	case 0:
-		precs = []int{DefaultPrecision}
+		return []int{DefaultPrecision}, nil
 	case 1:
-		// Do nothing.
-	default:
-		precs = append([]int(nil), precs...)
-		sort.Sort(sort.Reverse(sort.IntSlice(precs)))
-		i, j := 0, 1
-		for j < len(precs) {
-			if precs[i] > precs[j] {
-				i++
-				if i != j {
-					precs[i], precs[j] = precs[j], precs[i]
-				}
+		return precs, nil
+	}
+	precs = append([]int(nil), precs...)
+	sort.Sort(sort.Reverse(sort.IntSlice(precs)))
+	i, j := 0, 1
+	for j < len(precs) {
+		if precs[i] > precs[j] {
+			i++
+			if i != j {
+				precs[i], precs[j] = precs[j], precs[i]
 			}
-			j++
 		}
-		precs = precs[:i+1]
+		j++
+	}
+	return precs[:i+1], nil
+}
+
+// Compare compares the geocrypt hashed location with the location
+// at latitude and longitude and note text. The note text is appended
+// the the geohash of the location before comparing to the hashed
+// location. It returns the highest number of geohash precision bits
+// in the hash set on success or an error on failure. Hash sets
+// produced by HashWith with a KDF other than BcryptKDF are detected
+// from the KDF identifier HashWith prefixes them with and compared
+// using that KDF; plain bcrypt hashes, with no such prefix, are
+// compared as Hash has always compared them.
+func Compare(hashedLocation []byte, lat, long float64, text string) (bits int, err error) {
+	for _, h := range bytes.Split(hashedLocation, []byte{':'}) {
+		if bytes.HasPrefix(h, radiusPrefix) {
+			bits, err = compareRadiusCell(h, lat, long, text)
+		} else if kdf, rest, ok := dispatchKDF(h); ok {
+			bits, err = compareSegment(kdf, rest, lat, long, text)
+		} else {
+			bits, err = compare(h, lat, long, text)
+		}
+		if err == nil {
+			return bits, nil
+		}
+	}
+	return 0, ErrMismatchedHashAndLocation
+}
+
+func compare(hashedLocation []byte, lat, long float64, text string) (bits int, err error) {
+	if len(text) > 64 {
+		return 0, ErrTextTooLong
+	}
+	cost, err := bcrypt.Cost(hashedLocation)
+	if err != nil {
+		return 0, err
+	}
+	bits = 66 - cost
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], EncodeIntWithPrecision(lat, long, bits))
+	err = bcrypt.CompareHashAndPassword(hashedLocation, append(b[:], text...))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		bits = 0
+		err = ErrMismatchedHashAndLocation
 	}
+	return bits, err
+}
+
+// KDF is a pluggable key-derivation function backend for HashWith and
+// CompareWith. Implementations parameterise their work factor
+// differently (bcrypt's logarithmic rounds vs Argon2id's and scrypt's
+// independent time/memory knobs), so cost is opaque to callers and is
+// produced and consumed only through EncodeCost and the KDF's own
+// Derive/Verify pair.
+type KDF interface {
+	// Derive hashes password, salted with salt, at the given cost.
+	// salt is only meaningful to KDFs that take an explicit salt
+	// parameter; BcryptKDF ignores it, since bcrypt manages its own
+	// salt internally.
+	Derive(salt, password []byte, cost int) (hash []byte, err error)
+
+	// Verify reports whether password is the one hash was derived
+	// from, returning the cost hash was derived at on success. It
+	// returns ErrMismatchedHashAndLocation if password does not match.
+	Verify(hash, password []byte) (cost int, err error)
+
+	// EncodeCost returns the KDF-specific cost parameter corresponding
+	// to the given geohash bit precision.
+	EncodeCost(bits int) int
+}
+
+// saltSize is the number of random bytes of salt HashWith generates
+// for KDFs that take an explicit salt.
+const saltSize = 16
+
+// maskGeohashPrefix returns a copy of password with its leading 8
+// bytes, which callers of KDF.Derive and KDF.Verify use to carry the
+// geohash of the hashed location, masked to the given bit precision.
+func maskGeohashPrefix(password []byte, bits int) []byte {
+	masked := append([]byte(nil), password...)
+	if len(masked) < 8 {
+		return masked
+	}
+	gh := binary.BigEndian.Uint64(masked[:8]) & (^uint64(0) << (64 - bits))
+	binary.BigEndian.PutUint64(masked[:8], gh)
+	return masked
+}
+
+// BcryptKDF is the default KDF, used by Hash and Compare, and
+// reproduces geocrypt's original behaviour. bcrypt has no separate
+// salt parameter and caps passwords at 72 bytes. EncodeCost reproduces
+// the 66-bits mapping Hash has always used, so cost falls as precision
+// rises: MaxPrecision, at 60 bits and cost 6, is the finest precision
+// whose cost is not below bcrypt's minimum cost of 4.
+type BcryptKDF struct{}
+
+func (BcryptKDF) Derive(_, password []byte, cost int) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(maskGeohashPrefix(password, 66-cost), cost)
+}
+
+func (BcryptKDF) Verify(hash, password []byte) (cost int, err error) {
+	cost, err = bcrypt.Cost(hash)
+	if err != nil {
+		return 0, err
+	}
+	err = bcrypt.CompareHashAndPassword(hash, maskGeohashPrefix(password, 66-cost))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		err = ErrMismatchedHashAndLocation
+	}
+	return cost, err
+}
+
+func (BcryptKDF) EncodeCost(bits int) int {
+	return 66 - bits
+}
+
+// These are the fixed Argon2id parameters shared by every
+// Argon2idKDF hash; only the time parameter varies, scaled with the
+// geohash bit precision by argon2Time.
+const (
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+)
+
+func argon2Time(bits int) uint32 {
+	return uint32(1 + bits/8)
+}
+
+// Argon2idKDF derives geocrypt hashes with Argon2id. Unlike
+// BcryptKDF, it takes an explicit salt and has no fixed password
+// length or cost ceiling, so it is not subject to bcrypt's 72-byte
+// note-text limit or MaxPrecision; see MaxPrecisionArgon2. Its cost
+// is the geohash bit precision itself: EncodeCost is the identity
+// function, and the Argon2id time parameter is derived from it by
+// argon2Time, with memory and parallelism fixed.
+type Argon2idKDF struct{}
+
+func (Argon2idKDF) Derive(salt, password []byte, cost int) ([]byte, error) {
+	masked := maskGeohashPrefix(password, cost)
+	key := argon2.IDKey(masked, salt, argon2Time(cost), argon2Memory, argon2Threads, argon2KeyLen)
+	return encodeCostSaltHash(cost, salt, key), nil
+}
+
+func (Argon2idKDF) Verify(hash, password []byte) (cost int, err error) {
+	cost, salt, want, err := decodeCostSaltHash(hash)
+	if err != nil {
+		return 0, err
+	}
+	masked := maskGeohashPrefix(password, cost)
+	got := argon2.IDKey(masked, salt, argon2Time(cost), argon2Memory, argon2Threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return 0, ErrMismatchedHashAndLocation
+	}
+	return cost, nil
+}
+
+func (Argon2idKDF) EncodeCost(bits int) int {
+	return bits
+}
+
+// These are the fixed scrypt parameters shared by every
+// ScryptKDF hash; only N varies, scaled with the geohash bit
+// precision by scryptN.
+const (
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+func scryptN(bits int) int {
+	return 1 << uint(14+bits/16)
+}
+
+// ScryptKDF derives geocrypt hashes with scrypt. Like Argon2idKDF, it
+// has no fixed password length or cost ceiling and is bound by
+// MaxPrecisionArgon2 rather than MaxPrecision. Its cost is the
+// geohash bit precision itself: EncodeCost is the identity function,
+// and the scrypt N parameter is derived from it by scryptN, with r
+// and p fixed.
+type ScryptKDF struct{}
+
+func (ScryptKDF) Derive(salt, password []byte, cost int) ([]byte, error) {
+	masked := maskGeohashPrefix(password, cost)
+	key, err := scrypt.Key(masked, salt, scryptN(cost), scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	return encodeCostSaltHash(cost, salt, key), nil
+}
+
+func (ScryptKDF) Verify(hash, password []byte) (cost int, err error) {
+	cost, salt, want, err := decodeCostSaltHash(hash)
+	if err != nil {
+		return 0, err
+	}
+	masked := maskGeohashPrefix(password, cost)
+	got, err := scrypt.Key(masked, salt, scryptN(cost), scryptR, scryptP, len(want))
+	if err != nil {
+		return 0, err
+	}
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return 0, ErrMismatchedHashAndLocation
+	}
+	return cost, nil
+}
+
+func (ScryptKDF) EncodeCost(bits int) int {
+	return bits
+}
+
+// encodeCostSaltHash encodes cost, salt and hash as the colon-free,
+// dollar-separated "cost$salt$hash" body Argon2idKDF and ScryptKDF
+// use for their half of a geocrypt hash set, with salt and hash
+// base64 encoded.
+func encodeCostSaltHash(cost int, salt, hash []byte) []byte {
+	return []byte(fmt.Sprintf("%d$%s$%s", cost,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	))
+}
+
+func decodeCostSaltHash(b []byte) (cost int, salt, hash []byte, err error) {
+	parts := bytes.SplitN(b, []byte{'$'}, 3)
+	if len(parts) != 3 {
+		return 0, nil, nil, errors.New("geocrypt: malformed KDF hash")
+	}
+	cost, err = strconv.Atoi(string(parts[0]))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("geocrypt: malformed KDF cost: %w", err)
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("geocrypt: malformed KDF salt: %w", err)
+	}
+	hash, err = base64.RawStdEncoding.DecodeString(string(parts[2]))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("geocrypt: malformed KDF hash: %w", err)
+	}
+	return cost, salt, hash, nil
+}
+
+// kdfPrefixes maps the identifier HashWith prefixes a hash with to
+// the KDF that produced it. BcryptKDF is intentionally absent: its
+// hashes are left unprefixed for compatibility with Hash and Compare
+// as they have always behaved.
+var kdfPrefixes = []struct {
+	prefix []byte
+	kdf    KDF
+}{
+	{prefix: []byte("$geocrypt-argon2id$"), kdf: Argon2idKDF{}},
+	{prefix: []byte("$geocrypt-scrypt$"), kdf: ScryptKDF{}},
+}
+
+func prefixFor(kdf KDF) string {
+	for _, e := range kdfPrefixes {
+		if e.kdf == kdf {
+			return string(e.prefix)
+		}
+	}
+	return ""
+}
+
+// dispatchKDF reports whether h carries one of kdfPrefixes, returning
+// the matching KDF and h with the prefix removed.
+func dispatchKDF(h []byte) (kdf KDF, rest []byte, ok bool) {
+	for _, e := range kdfPrefixes {
+		if bytes.HasPrefix(h, e.prefix) {
+			return e.kdf, h[len(e.prefix):], true
+		}
+	}
+	return nil, h, false
+}
+
+// maxPrecisionFor returns the maximum geocrypt precision usable with
+// kdf: MaxPrecision for BcryptKDF, MaxPrecisionArgon2 otherwise.
+func maxPrecisionFor(kdf KDF) int {
+	if _, ok := kdf.(BcryptKDF); ok {
+		return MaxPrecision
+	}
+	return MaxPrecisionArgon2
+}
+
+// bitsFromCost inverts kdf.EncodeCost, recovering the geohash bit
+// precision a hash was derived at from the cost Verify reports.
+func bitsFromCost(kdf KDF, cost int) int {
+	if _, ok := kdf.(BcryptKDF); ok {
+		return 66 - cost
+	}
+	return cost
+}
+
+// HashWith returns a geocrypt hash set like Hash, but derives each
+// precision's hash with kdf instead of the default BcryptKDF. Hashes
+// produced with any KDF other than BcryptKDF are prefixed with a
+// short identifier naming it, which Compare and CompareWith use to
+// automatically select the matching KDF; BcryptKDF hashes are left
+// unprefixed, identical to those Hash produces. Backends other than
+// BcryptKDF are not limited to 64 bytes of note text and support
+// precisions up to MaxPrecisionArgon2 rather than MaxPrecision. If no
+// precision is given, DefaultPrecision is used.
+func HashWith(kdf KDF, lat, long float64, text string, precs ...int) ([]byte, error) {
+	precs, err := normalizePrecisionsFor(maxPrecisionFor(kdf), precs)
+	if err != nil {
+		return nil, err
+	}
+
+	var password [8]byte
+	binary.BigEndian.PutUint64(password[:], geohash(lat, long))
+	prefix := prefixFor(kdf)
 
 	var buf bytes.Buffer
 	for i, p := range precs {
@@ -81,26 +418,38 @@ func Hash(lat, long float64, text string, precs ...int) ([]byte, error) {
 			buf.WriteByte(':')
 		}
 		bits := Bits(p)
-		cost := 66 - bits
-		var b [72]byte
-		binary.BigEndian.PutUint64(b[:8], geohash(lat, long)&(^uint64(0)<<(64-bits)))
-		h, err := bcrypt.GenerateFromPassword(append(b[:8], text...), int(cost))
+		if bits > 64 {
+			return nil, fmt.Errorf("%w: precision %d needs %d geohash bits, more than a geohash holds", ErrInvalidPrecision, p, bits)
+		}
+		var salt []byte
+		if _, ok := kdf.(BcryptKDF); !ok {
+			salt = make([]byte, saltSize)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, err
+			}
+		}
+		h, err := kdf.Derive(salt, append(password[:], text...), kdf.EncodeCost(bits))
 		if err != nil {
 			return nil, err
 		}
+		buf.WriteString(prefix)
 		buf.Write(h)
 	}
 	return buf.Bytes(), nil
 }
 
-// Compare compares the geocrypt hashed location with the location
-// at latitude and longitude and note text. The note text is appended
-// the the geohash of the location before comparing to the hashed
-// location. It returns the highest number of geohash precision bits
-// in the hash set on success or an error on failure.
-func Compare(hashedLocation []byte, lat, long float64, text string) (bits int, err error) {
+// CompareWith compares a geocrypt hash set produced by HashWith(kdf,
+// ...) with the location at latitude and longitude and note text,
+// deriving candidate hashes with kdf rather than assuming bcrypt. It
+// returns the highest number of geohash precision bits in the hash
+// set on success or an error on failure.
+func CompareWith(kdf KDF, hashedLocation []byte, lat, long float64, text string) (bits int, err error) {
+	prefix := []byte(prefixFor(kdf))
 	for _, h := range bytes.Split(hashedLocation, []byte{':'}) {
-		bits, err = compare(h, lat, long, text)
+		if !bytes.HasPrefix(h, prefix) {
+			continue
+		}
+		bits, err = compareSegment(kdf, h[len(prefix):], lat, long, text)
 		if err == nil {
 			return bits, nil
 		}
@@ -108,25 +457,433 @@ func Compare(hashedLocation []byte, lat, long float64, text string) (bits int, e
 	return 0, ErrMismatchedHashAndLocation
 }
 
-func compare(hashedLocation []byte, lat, long float64, text string) (bits int, err error) {
+func compareSegment(kdf KDF, h []byte, lat, long float64, text string) (bits int, err error) {
+	var password [8]byte
+	binary.BigEndian.PutUint64(password[:], geohash(lat, long))
+	cost, err := kdf.Verify(h, append(password[:], text...))
+	if err != nil {
+		return 0, err
+	}
+	return bitsFromCost(kdf, cost), nil
+}
+
+// CompareTolerant compares the geocrypt hashed location with the
+// location at latitude and longitude and note text, as Compare does,
+// but additionally tests the eight geohash cells neighbouring the
+// caller's location at each precision encoded in the hash. This
+// recovers a match for a caller standing just across a geohash cell
+// boundary from the point that was originally hashed, where a single
+// metre of drift would otherwise flip the top bits of the cell and
+// cause Compare to fail. It returns the highest number of geohash
+// precision bits in the hash set on success, along with the
+// north/south and east/west offset of the matching cell relative to
+// the caller's own cell (0, 0 for an exact match), or an error on
+// failure. Only plain bcrypt hashes, as produced by Hash and
+// HashTolerant, are tested; hashes produced by HashWith with another
+// KDF or by HashRadius never match.
+func CompareTolerant(hashedLocation []byte, lat, long float64, text string) (bits, dlat, dlong int, err error) {
+	for _, h := range bytes.Split(hashedLocation, []byte{':'}) {
+		bits, dlat, dlong, err = compareTolerant(h, lat, long, text)
+		if err == nil {
+			return bits, dlat, dlong, nil
+		}
+	}
+	return 0, 0, 0, ErrMismatchedHashAndLocation
+}
+
+func compareTolerant(hashedLocation []byte, lat, long float64, text string) (bits, dlat, dlong int, err error) {
 	if len(text) > 64 {
-		return 0, ErrTextTooLong
+		return 0, 0, 0, ErrTextTooLong
 	}
 	cost, err := bcrypt.Cost(hashedLocation)
 	if err != nil {
-		return 0, err
+		return 0, 0, 0, err
 	}
 	bits = 66 - cost
+	gh := geohash(lat, long) & (^uint64(0) << (64 - bits))
+	for _, off := range append([][2]int{{0, 0}}, neighborOffsets[:]...) {
+		cell := neighborCell(gh, bits, off[0], off[1])
+		var b [72]byte
+		binary.BigEndian.PutUint64(b[:8], cell)
+		if bcrypt.CompareHashAndPassword(hashedLocation, append(b[:8], text...)) == nil {
+			return bits, off[0], off[1], nil
+		}
+	}
+	return 0, 0, 0, ErrMismatchedHashAndLocation
+}
+
+// HashTolerant returns a geocrypt hash set like Hash, but additionally
+// hashes the eight geohash cells neighbouring (lat, long) at each
+// precision. This bakes cell-boundary tolerance into the hash itself,
+// so the plain Compare function will later succeed for a caller
+// standing in any of the nine cells, at the cost of a hash set nine
+// times the size of the one Hash would produce.
+func HashTolerant(lat, long float64, text string, precs ...int) ([]byte, error) {
+	if len(text) > 64 {
+		return nil, ErrTextTooLong
+	}
+	precs, err := normalizePrecisions(precs)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for i, p := range precs {
+		bits := Bits(p)
+		cost := 66 - bits
+		gh := geohash(lat, long) & (^uint64(0) << (64 - bits))
+		for j, off := range append([][2]int{{0, 0}}, neighborOffsets[:]...) {
+			if i != 0 || j != 0 {
+				buf.WriteByte(':')
+			}
+			cell := neighborCell(gh, bits, off[0], off[1])
+			var b [72]byte
+			binary.BigEndian.PutUint64(b[:8], cell)
+			h, err := bcrypt.GenerateFromPassword(append(b[:8], text...), cost)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(h)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// neighborOffsets lists the eight row (latitude) and column
+// (longitude) offsets of the cells surrounding a reference cell, in
+// compass order starting at north.
+var neighborOffsets = [8][2]int{
+	{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1},
+}
+
+// neighborCell returns the geohash of the cell offset from gh by
+// dlat rows and dlong columns at the given bit precision. Longitude
+// wraps around the antimeridian; latitude saturates at the poles.
+func neighborCell(gh uint64, bits, dlat, dlong int) uint64 {
+	latPrec := bits / 2
+	longPrec := bits - latPrec
+	lat32, long32 := unzip(gh)
+	lat32 = stepLat(lat32, latPrec, dlat)
+	long32 = stepLong(long32, longPrec, dlong)
+	return zip(lat32, long32) & (^uint64(0) << (64 - bits))
+}
+
+// stepLat moves a latitude component by d cells of the given bit
+// precision, saturating at the poles rather than wrapping.
+func stepLat(v uint32, prec, d int) uint32 {
+	if d == 0 {
+		return v
+	}
+	delta := uint32(1) << uint(32-prec)
+	if d > 0 {
+		if v > ^uint32(0)-delta {
+			return ^uint32(0) &^ (delta - 1)
+		}
+		return v + delta
+	}
+	if v < delta {
+		return 0
+	}
+	return v - delta
+}
+
+// stepLong moves a longitude component by d cells of the given bit
+// precision, wrapping around the antimeridian. Wraparound falls out
+// of plain uint32 overflow because integer encodes longitude linearly
+// over the full range of the type.
+func stepLong(v uint32, prec, d int) uint32 {
+	if d == 0 {
+		return v
+	}
+	delta := uint32(1) << uint(32-prec)
+	if d > 0 {
+		return v + delta
+	}
+	return v - delta
+}
+
+// radiusPrefix marks a HashRadius covering-cell hash within a
+// colon-separated hash set, so Compare can recognise and dispatch it
+// alongside plain bcrypt and KDF-prefixed segments.
+var radiusPrefix = []byte("$geocrypt-radius$")
+
+// radiusMaxCost bounds the bcrypt cost radiusCost ever returns.
+const radiusMaxCost = 10
+
+// radiusCost returns the bcrypt work factor for a single radius-
+// covering cell hash. HashRadius may need to hash hundreds of
+// covering cells in a single call, so its cost is kept on its own
+// low, bounded ladder here rather than following Hash's point-hash
+// cost/bits coupling (cost = 66 - bits): that coupling compensates
+// coarser (lower bits) cells with a higher cost to offset their
+// smaller search space, but a radius covering needs coarse cells
+// precisely to keep the covering small, which would drive bcrypt's
+// cost towards its 31 round ceiling and make HashRadius impractically
+// slow for the radii it is meant to support.
+func radiusCost(bits int) int {
+	cost := bcrypt.MinCost + (64-bits)/8
+	if cost > radiusMaxCost {
+		cost = radiusMaxCost
+	}
+	return cost
+}
+
+// defaultRadiusPrecision picks the geocrypt precision HashRadius uses
+// when the caller gives none. It returns the finest precision whose
+// cell, at the given latitude, is still at least as large as
+// radiusMeters in both dimensions, so the resulting covering stays
+// small, falling back to MinPrecision for radii coarser than even its
+// cell. Longitude degrees shrink towards the poles, so the longitude
+// span is scaled by cos(lat) to get its metre width at that latitude.
+func defaultRadiusPrecision(lat, radiusMeters float64) int {
+	const metresPerDegree = earthRadius * math.Pi / 180
+	longScale := metresPerDegree * math.Cos(radians(lat))
+	for prec := MaxPrecision; prec > MinPrecision; prec-- {
+		latSpan, longSpan := Error(Bits(prec))
+		if latSpan*metresPerDegree >= radiusMeters && longSpan*longScale >= radiusMeters {
+			return prec
+		}
+	}
+	return MinPrecision
+}
+
+// HashRadius returns a geocrypt hash set covering the disc of radius
+// radiusMeters centred at (lat, long), rather than hashing a single
+// point. For each requested precision it computes the minimum
+// covering of geohash cells whose bounding box intersects the disc,
+// and hashes each covering cell separately at radiusCost's bounded
+// work factor rather than Hash's point-hash cost. The resulting hash
+// set lets a verifier prove they are within radiusMeters of the
+// hashed location without the hash revealing exactly where that
+// location is: Compare (or CompareRadius) succeeds if the caller's
+// own cell is among the cells that were covered. If no precision is
+// given, one is chosen, via defaultRadiusPrecision, so that the
+// covering's cells are close in size to radiusMeters: DefaultPrecision
+// is tuned for a single point and its sub-metre cells would need an
+// impractically large covering for any realistic radius.
+// ErrInvalidRadius is returned if radiusMeters is not positive, and
+// ErrInvalidPrecision is returned if a requested precision is too
+// fine for the given radius, since the covering would then require an
+// impractically large number of cells.
+func HashRadius(lat, long, radiusMeters float64, text string, precs ...int) ([]byte, error) {
+	if len(text) > 64 {
+		return nil, ErrTextTooLong
+	}
+	if !(radiusMeters > 0) {
+		return nil, ErrInvalidRadius
+	}
+	if len(precs) == 0 {
+		precs = []int{defaultRadiusPrecision(lat, radiusMeters)}
+	}
+	precs, err := normalizePrecisions(precs)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	first := true
+	for _, p := range precs {
+		bits := Bits(p)
+		cost := radiusCost(bits)
+		cells, err := radiusCovering(lat, long, radiusMeters, bits)
+		if err != nil {
+			return nil, err
+		}
+		for _, cell := range cells {
+			if !first {
+				buf.WriteByte(':')
+			}
+			first = false
+			var b [72]byte
+			binary.BigEndian.PutUint64(b[:8], cell)
+			h, err := bcrypt.GenerateFromPassword(append(b[:8], text...), cost)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(radiusPrefix)
+			buf.WriteString(strconv.Itoa(bits))
+			buf.WriteByte('$')
+			buf.Write(h)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// compareRadiusCell compares a single radiusPrefix-prefixed covering
+// cell hash, as produced by HashRadius, with the location at latitude
+// and longitude and note text. Since radiusCost decouples bcrypt cost
+// from bit precision, the cell's bit precision is read from the
+// hash's own radiusPrefix header rather than inferred from its
+// bcrypt cost, unlike compare.
+func compareRadiusCell(h []byte, lat, long float64, text string) (bits int, err error) {
+	if len(text) > 64 {
+		return 0, ErrTextTooLong
+	}
+	rest := h[len(radiusPrefix):]
+	parts := bytes.SplitN(rest, []byte{'$'}, 2)
+	if len(parts) != 2 {
+		return 0, errors.New("geocrypt: malformed radius hash")
+	}
+	bits, err = strconv.Atoi(string(parts[0]))
+	if err != nil {
+		return 0, fmt.Errorf("geocrypt: malformed radius bits: %w", err)
+	}
 	var b [8]byte
-	binary.BigEndian.PutUint64(b[:], geohash(lat, long)&(^uint64(0)<<(64-bits)))
-	err = bcrypt.CompareHashAndPassword(hashedLocation, append(b[:], text...))
+	binary.BigEndian.PutUint64(b[:], EncodeIntWithPrecision(lat, long, bits))
+	err = bcrypt.CompareHashAndPassword(parts[1], append(b[:], text...))
 	if err == bcrypt.ErrMismatchedHashAndPassword {
-		bits = 0
 		err = ErrMismatchedHashAndLocation
 	}
 	return bits, err
 }
 
+// CompareRadius compares a geocrypt hash set produced by HashRadius
+// with the location at latitude and longitude and note text. It
+// succeeds if (lat, long) falls within one of the covering cells
+// baked into the hash set by HashRadius, i.e. within radiusMeters of
+// the original centre at the matching precision. Since HashRadius
+// hashes are just a larger colon-separated hash set, each segment
+// self-describing its own bit precision via radiusPrefix, CompareRadius
+// is Compare under another name.
+func CompareRadius(hashedLocation []byte, lat, long float64, text string) (bits int, err error) {
+	return Compare(hashedLocation, lat, long, text)
+}
+
+// maxRadiusCells bounds the number of cells a single precision's
+// radius covering may contain, guarding against a precision so fine
+// relative to the radius that the covering would be impractically
+// large.
+const maxRadiusCells = 512
+
+// radiusCovering returns the geohashes, at the given bit precision,
+// of every cell whose bounding box intersects the disc of radius
+// radiusMeters centred at (lat, long). It starts from the cell
+// containing the centre and grows outward over the cell grid using
+// neighborCell, using Error and haversine to test each candidate
+// cell's bounding box against the disc, until no further adjacent
+// cell is in range.
+func radiusCovering(lat, long, radiusMeters float64, bits int) ([]uint64, error) {
+	if !(radiusMeters > 0) {
+		return nil, ErrInvalidRadius
+	}
+	latSpan, longSpan := Error(bits)
+	centerGh := geohash(lat, long) & (^uint64(0) << (64 - bits))
+
+	type candidate struct {
+		gh     uint64
+		offset [2]int
+	}
+	visited := map[[2]int]bool{{0, 0}: true}
+	queue := []candidate{{centerGh, [2]int{0, 0}}}
+	var covering []uint64
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		// cellLat, cellLong is the cell's lower (south-west) corner;
+		// the cell extends latSpan degrees north and longSpan degrees
+		// east of it.
+		cellLat, cellLong := float(unzip(c.gh))
+		dist := boundingBoxDistance(lat, long, cellLat, cellLong, latSpan, longSpan)
+		if dist > radiusMeters {
+			continue
+		}
+		covering = append(covering, c.gh)
+		if len(covering) > maxRadiusCells {
+			return nil, fmt.Errorf("%w: radius %gm too large for precision bits=%d", ErrInvalidPrecision, radiusMeters, bits)
+		}
+		for _, off := range neighborOffsets {
+			key := [2]int{c.offset[0] + off[0], c.offset[1] + off[1]}
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			queue = append(queue, candidate{neighborCell(c.gh, bits, off[0], off[1]), key})
+		}
+	}
+	return covering, nil
+}
+
+// boundingBoxDistance returns the haversine distance in metres from
+// (lat, long) to the nearest point of the latitude/longitude
+// bounding box whose south-west corner is (cellLat, cellLong) and
+// which extends latSpan degrees north and longSpan degrees east of
+// it.
+func boundingBoxDistance(lat, long, cellLat, cellLong, latSpan, longSpan float64) float64 {
+	nearLat := clamp(lat, cellLat, cellLat+latSpan)
+	nearLong := clamp(long, cellLong, cellLong+longSpan)
+	return haversine(lat, long, nearLat, nearLong)
+}
+
+func clamp(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// earthRadius is the mean radius of the Earth in metres, used to
+// convert between angular and linear distance.
+const earthRadius = 6371e3
+
+// haversine returns the great-circle distance in metres between the
+// two given latitude/longitude points.
+func haversine(lat1, long1, lat2, long2 float64) float64 {
+	sdLat := math.Sin(radians(lat2-lat1) / 2)
+	sdLong := math.Sin(radians(long2-long1) / 2)
+	a := sdLat*sdLat + math.Cos(radians(lat1))*math.Cos(radians(lat2))*sdLong*sdLong
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+// GeohashStd returns the canonical geohash string for the given
+// latitude and longitude at the given number of base32 characters,
+// following the convention popularised by geohash.org and implemented
+// by the wider geohash ecosystem (Rosetta Code, mmcloughlin/geohash,
+// tidwall/geohash and others): chars ranges from 1 to 12 and encodes
+// 5*chars bits, interleaving longitude and latitude bits with
+// longitude first in each pair. The strings it produces can be fed to
+// other geohash tooling, and decoded by LocationStd or by that
+// tooling, interchangeably with geocrypt's own Geohash, which already
+// uses the same bit order and alphabet but is parameterised by bit
+// count rather than character count.
+func GeohashStd(lat, long float64, chars int) (string, error) {
+	if chars < 1 || 12 < chars {
+		return "", ErrInvalidPrecision
+	}
+	gh, err := Geohash(lat, long, 5*chars)
+	if err != nil {
+		return "", err
+	}
+	return string(gh), nil
+}
+
+// LocationStd decodes a canonical geohash string, as produced by
+// GeohashStd or by other geohash.org-compatible tooling, returning
+// the centre of the encoded cell and the number of characters decoded.
+// Unlike Location, which returns the cell's lower (south-west) corner,
+// LocationStd returns the cell centroid, matching the convention used
+// by that ecosystem. geohash must be between 1 and 12 characters.
+func LocationStd(geohash string) (lat, long float64, chars int, err error) {
+	chars = len(geohash)
+	if chars < 1 || 12 < chars {
+		return 0, 0, 0, ErrInvalidPrecision
+	}
+	lat, long, bits, err := Location([]byte(geohash))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	latSpan, longSpan := Error(bits)
+	return lat + latSpan/2, long + longSpan/2, chars, nil
+}
+
 // Bits returns the geohash bit precision corresponding to the given
 // geocrypt precision.
 func Bits(prec int) int {
@@ -139,14 +896,117 @@ func Prec(bits int) int {
 	return bits/4 - 6
 }
 
+// Direction is a compass direction used by NeighborInt to select a
+// cell adjacent to a reference geohash.
+type Direction int
+
+// The eight compass directions accepted by NeighborInt, in the same
+// order as neighborOffsets.
+const (
+	N Direction = iota
+	NE
+	E
+	SE
+	S
+	SW
+	W
+	NW
+)
+
+// EncodeInt returns the 64 bit interleaved geohash for the given
+// latitude and longitude, to the full 32 bit precision of each axis.
+// Unlike Geohash, the result is not truncated to a bit precision or
+// base32 encoded, so it can be used as a map key, database index, or
+// input to NeighborInt and DecodeInt without a string round trip.
+func EncodeInt(lat, long float64) uint64 {
+	return geohash(lat, long)
+}
+
+// EncodeIntWithPrecision returns the geohash for the given latitude
+// and longitude, masked to the given bit precision as Geohash and
+// HashWith do. The value of bits must be between 0 and 64 inclusive;
+// out of range values are clamped.
+func EncodeIntWithPrecision(lat, long float64, bits int) uint64 {
+	if bits < 0 {
+		bits = 0
+	} else if bits > 64 {
+		bits = 64
+	}
+	return geohash(lat, long) & (^uint64(0) << (64 - bits))
+}
+
+// DecodeInt returns the latitude and longitude of the lower (south-
+// west) corner of the cell encoded by hash at the given bit precision,
+// the integer analogue of Location. The value of bits must be between
+// 0 and 64 inclusive; out of range values are clamped. Bits of hash
+// beyond the given precision are ignored.
+func DecodeInt(hash uint64, bits int) (lat, long float64) {
+	if bits < 0 {
+		bits = 0
+	} else if bits > 64 {
+		bits = 64
+	}
+	hash &= ^uint64(0) << (64 - bits)
+	return float(unzip(hash))
+}
+
+// NeighborInt returns the geohash of the cell adjacent to hash in the
+// given compass direction, at the given bit precision, the integer
+// analogue of the cell adjacency used by CompareTolerant and
+// HashTolerant. Longitude wraps around the antimeridian; latitude
+// saturates at the poles. The value of bits must be between 0 and 64
+// inclusive; out of range values are clamped. dir should be one of
+// the named Direction constants; other values wrap modulo 8.
+func NeighborInt(hash uint64, bits int, dir Direction) uint64 {
+	if bits < 0 {
+		bits = 0
+	} else if bits > 64 {
+		bits = 64
+	}
+	off := neighborOffsets[((int(dir)%8)+8)%8]
+	return neighborCell(hash, bits, off[0], off[1])
+}
+
+// base32Alphabet is the geohash base32 alphabet: the digits and
+// lower-case letters, omitting a, i, l and o to avoid confusion with
+// 1, 0 and transcription errors.
+const base32Alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// AppendBase32 appends the base32 encoding of the top 5*chars bits of
+// hash, interpreted as a geohash in the form EncodeInt returns, to dst
+// and returns the extended buffer. It lets high-throughput callers
+// reuse a buffer across calls rather than allocating a new one each
+// time, as base32 does internally. The value of chars must be between
+// 0 and 12 inclusive; out of range values are clamped.
+func AppendBase32(dst []byte, hash uint64, chars int) []byte {
+	if chars < 0 {
+		chars = 0
+	} else if chars > 12 {
+		chars = 12
+	}
+	for i := 0; i < chars; i++ {
+		dst = append(dst, base32Alphabet[(hash>>uint(59-5*i))&0x1f])
+	}
+	return dst
+}
+
+// AppendGeohash appends the geohash for the given latitude and
+// longitude at the given bit precision to dst and returns the
+// extended buffer, avoiding the allocation Geohash performs internally
+// when dst already has enough spare capacity. The value of bits must
+// not be less than five or greater than 60.
+func AppendGeohash(dst []byte, lat, long float64, bits int) ([]byte, error) {
+	if bits < 5 || 60 < bits {
+		return nil, ErrInvalidPrecision
+	}
+	return AppendBase32(dst, EncodeInt(lat, long), bits/5), nil
+}
+
 // Geohash returns the geohash for the given latitude and longitude with
 // the given bit precision. The value of bits must not be less than five
 // or greater than 60.
 func Geohash(lat, long float64, bits int) ([]byte, error) {
-	if bits < 5 || 60 < bits {
-		return nil, ErrInvalidPrecision
-	}
-	return base32(geohash(lat, long) >> 4)[:bits/5], nil
+	return AppendGeohash(nil, lat, long, bits)
 }
 
 func geohash(lat, long float64) uint64 {
@@ -180,7 +1040,7 @@ func Location(geohash []byte) (lat, long float64, bits int, err error) {
 	if err != nil {
 		return 0, 0, 0, err
 	}
-	lat, long = float(unzip(gh << (64 - bits)))
+	lat, long = DecodeInt(gh<<(64-bits), bits)
 	return lat, long, bits, nil
 }
 
@@ -5,6 +5,7 @@
 package geocrypt
 
 import (
+	"errors"
 	"math"
 	"testing"
 	"testing/quick"
@@ -26,13 +27,13 @@ func TestHashCompare(t *testing.T) {
 	for _, test := range locationTests {
 		for _, prec := range precs {
 			s := time.Now()
-			h, err := Hash(test.lat, test.long, prec)
+			h, err := Hash(test.lat, test.long, "", prec)
 			if err != nil {
 				t.Errorf("unexpected hash error: %v", err)
 			}
 			hashTime := time.Since(s)
 			s = time.Now()
-			err = Compare(h, test.lat, test.long)
+			_, err = Compare(h, test.lat, test.long, "")
 			if err != nil {
 				t.Errorf("unexpected hash comparison error: %v", err)
 			}
@@ -50,17 +51,80 @@ func TestHashCompare(t *testing.T) {
 	}
 }
 
-func haversine(lat1, long1, lat2, long2 float64) float64 {
-	const r = 6371e3 // m
-	sdLat := math.Sin(radians(lat2-lat1) / 2)
-	sdLong := math.Sin(radians(long2-long1) / 2)
-	a := sdLat*sdLat + math.Cos(radians(lat1))*math.Cos(radians(lat2))*sdLong*sdLong
-	d := 2 * r * math.Asin(math.Sqrt(a))
-	return d // m
+func TestCompareTolerant(t *testing.T) {
+	test := locationTests[0]
+	prec := 9
+	bits := Bits(prec)
+	h, err := Hash(test.lat, test.long, "Kryptos", prec)
+	if err != nil {
+		t.Fatalf("unexpected hash error: %v", err)
+	}
+
+	gotBits, dlat, dlong, err := CompareTolerant(h, test.lat, test.long, "Kryptos")
+	if err != nil {
+		t.Fatalf("unexpected error for exact match: %v", err)
+	}
+	if gotBits != bits || dlat != 0 || dlong != 0 {
+		t.Errorf("unexpected exact match result: bits=%d dlat=%d dlong=%d", gotBits, dlat, dlong)
+	}
+
+	center := EncodeIntWithPrecision(test.lat, test.long, bits)
+	latSpan, longSpan := Error(bits)
+	for d := Direction(0); d < 8; d++ {
+		neighbor := NeighborInt(center, bits, d)
+		cellLat, cellLong := DecodeInt(neighbor, bits)
+		nlat, nlong := cellLat+latSpan/2, cellLong+longSpan/2
+
+		gotBits, dlat, dlong, err := CompareTolerant(h, nlat, nlong, "Kryptos")
+		if err != nil {
+			t.Errorf("direction %d: unexpected error: %v", d, err)
+			continue
+		}
+		if gotBits != bits {
+			t.Errorf("direction %d: unexpected bits: got:%d want:%d", d, gotBits, bits)
+		}
+		// dlat, dlong is the offset of the matching (originally
+		// hashed) cell relative to the caller's own cell, the
+		// inverse of the direction the caller moved away from it.
+		off := neighborOffsets[d]
+		wantLat, wantLong := -off[0], -off[1]
+		if dlat != wantLat || dlong != wantLong {
+			t.Errorf("direction %d: unexpected offset: got:(%d,%d) want:(%d,%d)", d, dlat, dlong, wantLat, wantLong)
+		}
+	}
+
+	if _, _, _, err := CompareTolerant(h, test.lat+10, test.long+10, "Kryptos"); err != ErrMismatchedHashAndLocation {
+		t.Errorf("unexpected error for clear miss: got:%v want:%v", err, ErrMismatchedHashAndLocation)
+	}
 }
 
-func radians(d float64) float64 {
-	return d * math.Pi / 180
+func TestHashTolerant(t *testing.T) {
+	test := locationTests[0]
+	prec := 9
+	bits := Bits(prec)
+	h, err := HashTolerant(test.lat, test.long, "Kryptos", prec)
+	if err != nil {
+		t.Fatalf("unexpected hash error: %v", err)
+	}
+
+	if _, err := Compare(h, test.lat, test.long, "Kryptos"); err != nil {
+		t.Errorf("unexpected error for exact match: %v", err)
+	}
+
+	center := EncodeIntWithPrecision(test.lat, test.long, bits)
+	latSpan, longSpan := Error(bits)
+	for d := Direction(0); d < 8; d++ {
+		neighbor := NeighborInt(center, bits, d)
+		cellLat, cellLong := DecodeInt(neighbor, bits)
+		nlat, nlong := cellLat+latSpan/2, cellLong+longSpan/2
+		if _, err := Compare(h, nlat, nlong, "Kryptos"); err != nil {
+			t.Errorf("direction %d: unexpected error: %v", d, err)
+		}
+	}
+
+	if _, err := Compare(h, test.lat+10, test.long+10, "Kryptos"); err != ErrMismatchedHashAndLocation {
+		t.Errorf("unexpected error for clear miss: got:%v want:%v", err, ErrMismatchedHashAndLocation)
+	}
 }
 
 func TestBase32(t *testing.T) {
@@ -124,3 +188,256 @@ func TestBitsPrec(t *testing.T) {
 		}
 	}
 }
+
+// stdGeohashTests are known geohashes produced by Rosetta Code's
+// geohash task and the wider ecosystem (mmcloughlin/geohash,
+// tidwall/geohash), used to check geocrypt's standard-format geohash
+// strings interoperate with other implementations.
+var stdGeohashTests = []struct {
+	geohash  string
+	location string
+	lat      float64
+	long     float64
+}{
+	{geohash: "gc", location: "all of Ireland"},
+	{geohash: "gcpue5hp4", location: "Wimbledon Centre Court umpire's chair", lat: 51.43374, long: -0.21413},
+	{geohash: "u4pruydqqvj", location: "Skagen, Denmark", lat: 57.64911, long: 10.40744},
+}
+
+func TestGeohashStdConformance(t *testing.T) {
+	for _, test := range stdGeohashTests {
+		lat, long, chars, err := LocationStd(test.geohash)
+		if err != nil {
+			t.Errorf("%s (%s): unexpected error: %v", test.geohash, test.location, err)
+			continue
+		}
+		if chars != len(test.geohash) {
+			t.Errorf("%s (%s): unexpected chars: got:%d want:%d", test.geohash, test.location, chars, len(test.geohash))
+		}
+		if test.lat != 0 || test.long != 0 {
+			latErr, longErr := Error(5 * chars)
+			if lat < test.lat-latErr || test.lat+latErr < lat {
+				t.Errorf("%s (%s): latitude out of error bound: got:%f want:%f(±%f)", test.geohash, test.location, lat, test.lat, latErr)
+			}
+			if long < test.long-longErr || test.long+longErr < long {
+				t.Errorf("%s (%s): longitude out of error bound: got:%f want:%f(±%f)", test.geohash, test.location, long, test.long, longErr)
+			}
+		}
+
+		got, err := GeohashStd(lat, long, chars)
+		if err != nil {
+			t.Errorf("%s (%s): unexpected error: %v", test.geohash, test.location, err)
+			continue
+		}
+		if got != test.geohash {
+			t.Errorf("%s (%s): round trip mismatch: got:%s", test.geohash, test.location, got)
+		}
+	}
+}
+
+func TestGeohashStdInvalidChars(t *testing.T) {
+	for _, chars := range []int{0, 13} {
+		if _, err := GeohashStd(0, 0, chars); err != ErrInvalidPrecision {
+			t.Errorf("unexpected error for chars=%d: got:%v want:%v", chars, err, ErrInvalidPrecision)
+		}
+	}
+	for _, geohash := range []string{"", "0123456789abc"} {
+		if _, _, _, err := LocationStd(geohash); err != ErrInvalidPrecision {
+			t.Errorf("unexpected error for geohash=%q: got:%v want:%v", geohash, err, ErrInvalidPrecision)
+		}
+	}
+}
+
+func TestHashRadiusCompareRadius(t *testing.T) {
+	test := locationTests[1]
+	const radiusMeters = 200
+	const prec = 2
+
+	h, err := HashRadius(test.lat, test.long, radiusMeters, "Kryptos", prec)
+	if err != nil {
+		t.Fatalf("unexpected hash error: %v", err)
+	}
+
+	if _, err := CompareRadius(h, test.lat, test.long, "Kryptos"); err != nil {
+		t.Errorf("unexpected error for centre match: %v", err)
+	}
+
+	// A point displaced well within radiusMeters, but possibly into a
+	// different covering cell, should still match.
+	const metresPerDegree = 111320
+	nearLat := test.lat + 0.7*radiusMeters/metresPerDegree
+	if haversine(test.lat, test.long, nearLat, test.long) >= radiusMeters {
+		t.Fatalf("test setup: displaced point is not within radiusMeters")
+	}
+	if _, err := CompareRadius(h, nearLat, test.long, "Kryptos"); err != nil {
+		t.Errorf("unexpected error for near-boundary match: %v", err)
+	}
+
+	if _, err := CompareRadius(h, test.lat+10, test.long+10, "Kryptos"); err != ErrMismatchedHashAndLocation {
+		t.Errorf("unexpected error for clear miss: got:%v want:%v", err, ErrMismatchedHashAndLocation)
+	}
+
+	if _, err := HashRadius(test.lat, test.long, 5, "Kryptos", MaxPrecision); !errors.Is(err, ErrInvalidPrecision) {
+		t.Errorf("unexpected error for radius too small for precision: got:%v want:%v", err, ErrInvalidPrecision)
+	}
+
+	if _, err := HashRadius(test.lat, test.long, 0, "Kryptos"); !errors.Is(err, ErrInvalidRadius) {
+		t.Errorf("unexpected error for zero radius: got:%v want:%v", err, ErrInvalidRadius)
+	}
+	if _, err := HashRadius(test.lat, test.long, -radiusMeters, "Kryptos"); !errors.Is(err, ErrInvalidRadius) {
+		t.Errorf("unexpected error for negative radius: got:%v want:%v", err, ErrInvalidRadius)
+	}
+	if _, err := HashRadius(test.lat, test.long, math.NaN(), "Kryptos"); !errors.Is(err, ErrInvalidRadius) {
+		t.Errorf("unexpected error for NaN radius: got:%v want:%v", err, ErrInvalidRadius)
+	}
+}
+
+// TestHashRadiusDefaultPrecision checks that HashRadius, given no
+// explicit precision, picks one coarse enough to produce a usable
+// covering for a realistic radius, rather than falling back to
+// DefaultPrecision's single-point precision.
+func TestHashRadiusDefaultPrecision(t *testing.T) {
+	test := locationTests[1]
+	const radiusMeters = 50
+
+	h, err := HashRadius(test.lat, test.long, radiusMeters, "secret")
+	if err != nil {
+		t.Fatalf("unexpected hash error: %v", err)
+	}
+	if _, err := CompareRadius(h, test.lat, test.long, "secret"); err != nil {
+		t.Errorf("unexpected error for centre match: %v", err)
+	}
+	if _, err := CompareRadius(h, test.lat+10, test.long+10, "secret"); err != ErrMismatchedHashAndLocation {
+		t.Errorf("unexpected error for clear miss: got:%v want:%v", err, ErrMismatchedHashAndLocation)
+	}
+}
+
+// kdfTests exercises HashWith/CompareWith for each of the non-default
+// KDF implementations at a modest cost so the test runs quickly.
+var kdfTests = []struct {
+	name string
+	kdf  KDF
+	prec int
+}{
+	{name: "argon2id", kdf: Argon2idKDF{}, prec: 6},
+	{name: "scrypt", kdf: ScryptKDF{}, prec: 6},
+}
+
+func TestHashWithCompareWith(t *testing.T) {
+	test := locationTests[0]
+	longText := string(make([]byte, 200))
+	for _, kt := range kdfTests {
+		t.Run(kt.name, func(t *testing.T) {
+			h, err := HashWith(kt.kdf, test.lat, test.long, longText, kt.prec)
+			if err != nil {
+				t.Fatalf("unexpected hash error: %v", err)
+			}
+			bits, err := CompareWith(kt.kdf, h, test.lat, test.long, longText)
+			if err != nil {
+				t.Fatalf("unexpected compare error: %v", err)
+			}
+			if want := Bits(kt.prec); bits != want {
+				t.Errorf("unexpected bits: got:%d want:%d", bits, want)
+			}
+			if _, err := CompareWith(kt.kdf, h, test.lat+1, test.long+1, longText); err != ErrMismatchedHashAndLocation {
+				t.Errorf("unexpected error for mismatched location: got:%v want:%v", err, ErrMismatchedHashAndLocation)
+			}
+		})
+	}
+}
+
+func TestCompareAutoDispatch(t *testing.T) {
+	test := locationTests[0]
+	for _, kt := range kdfTests {
+		t.Run(kt.name, func(t *testing.T) {
+			h, err := HashWith(kt.kdf, test.lat, test.long, "Kryptos", kt.prec)
+			if err != nil {
+				t.Fatalf("unexpected hash error: %v", err)
+			}
+			bits, err := Compare(h, test.lat, test.long, "Kryptos")
+			if err != nil {
+				t.Fatalf("unexpected compare error: %v", err)
+			}
+			if want := Bits(kt.prec); bits != want {
+				t.Errorf("unexpected bits: got:%d want:%d", bits, want)
+			}
+		})
+	}
+}
+
+func TestHashWithPrecisionTooFine(t *testing.T) {
+	if _, err := HashWith(Argon2idKDF{}, 0, 0, "Kryptos", 12); err == nil {
+		t.Error("expected error for precision exceeding 64 geohash bits")
+	}
+}
+
+func TestEncodeDecodeInt(t *testing.T) {
+	quick.Check(func(lat, long float64, bits int) bool {
+		if math.IsNaN(lat) || math.IsNaN(long) {
+			return true
+		}
+		lat = math.Mod(lat, 90)
+		long = math.Mod(long, 180)
+		if bits < 0 {
+			bits = -bits
+		}
+		bits = bits%56 + 5
+
+		hash := EncodeIntWithPrecision(lat, long, bits)
+		_lat, _long := DecodeInt(hash, bits)
+		latErr, longErr := Error(bits)
+		ok := true
+		if _lat < lat-latErr || lat+latErr < _lat {
+			t.Errorf("latitude out of error bound bits=%d: lat=%f(±%f) long=%f(±%f) got=%f",
+				bits, lat, latErr, long, longErr, _lat)
+			ok = false
+		}
+		if _long < long-longErr || long+longErr < _long {
+			t.Errorf("longitude out of error bound bits=%d: lat=%f(±%f) long=%f(±%f) got=%f",
+				bits, lat, latErr, long, longErr, _long)
+			ok = false
+		}
+		return ok
+	}, nil)
+}
+
+func TestAppendBase32MatchesGeohash(t *testing.T) {
+	for _, test := range locationTests {
+		for bits := 5; bits <= 60; bits += 5 {
+			want, err := Geohash(test.lat, test.long, bits)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := AppendBase32(nil, EncodeInt(test.lat, test.long), bits/5)
+			if string(got) != string(want) {
+				t.Errorf("bits=%d: got:%s want:%s", bits, got, want)
+			}
+		}
+	}
+}
+
+func TestNeighborInt(t *testing.T) {
+	test := locationTests[0]
+	bits := Bits(DefaultPrecision)
+	center := EncodeIntWithPrecision(test.lat, test.long, bits)
+	centerLat, centerLong := DecodeInt(center, bits)
+	latSpan, longSpan := Error(bits)
+
+	north := NeighborInt(center, bits, N)
+	northLat, northLong := DecodeInt(north, bits)
+	if math.Abs(northLat-(centerLat+latSpan)) > 1e-9 {
+		t.Errorf("unexpected north latitude: got:%f want:%f", northLat, centerLat+latSpan)
+	}
+	if northLong != centerLong {
+		t.Errorf("unexpected north longitude: got:%f want:%f", northLong, centerLong)
+	}
+
+	east := NeighborInt(center, bits, E)
+	eastLat, eastLong := DecodeInt(east, bits)
+	if eastLat != centerLat {
+		t.Errorf("unexpected east latitude: got:%f want:%f", eastLat, centerLat)
+	}
+	if math.Abs(eastLong-(centerLong+longSpan)) > 1e-9 {
+		t.Errorf("unexpected east longitude: got:%f want:%f", eastLong, centerLong+longSpan)
+	}
+}